@@ -0,0 +1,99 @@
+package publish
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ybbus/jsonrpc"
+)
+
+// ErrorKind classifies an Error into one of the categories a wire client
+// can use to decide whether (and how) to retry, without having to parse
+// Message.
+type ErrorKind string
+
+// The error kinds Handle, Publish and the resumable upload handlers can
+// produce.
+const (
+	ErrKindAuth       ErrorKind = "auth"
+	ErrKindQuota      ErrorKind = "quota"
+	ErrKindStorage    ErrorKind = "storage"
+	ErrKindSDK        ErrorKind = "sdk"
+	ErrKindValidation ErrorKind = "validation"
+)
+
+// JSON-RPC error codes for each kind, taken from the "reserved for
+// implementation-defined server errors" range (-32000 to -32099).
+const (
+	codeAuth       = -32000
+	codeQuota      = -32001
+	codeStorage    = -32002
+	codeSDK        = -32003
+	codeValidation = -32004
+)
+
+// Error is the wire format for every failure the publish package can
+// produce. It implements the error interface so it can be returned and
+// wrapped like any other error, and AsBytes so it can be written straight
+// to the response body in place of the JSON-RPC result.
+type Error struct {
+	Kind    ErrorKind `json:"kind"`
+	Message string    `json:"message"`
+	code    int
+}
+
+// Error implements error.
+func (e Error) Error() string { return e.Message }
+
+// AsBytes serializes e as a JSON-RPC 2.0 error response, mirroring the
+// shape LbrynetPublisher.Publish uses for its successful responses.
+func (e Error) AsBytes() []byte {
+	response := jsonrpc.RPCResponse{
+		Error: &jsonrpc.RPCError{
+			Code:    e.code,
+			Message: e.Message,
+			Data:    e.Kind,
+		},
+	}
+	serialized, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		// response is a plain struct of strings and ints and cannot fail
+		// to marshal; this is here so an error path can never itself
+		// panic.
+		return []byte(fmt.Sprintf(`{"error":{"code":%d,"message":%q}}`, e.code, e.Message))
+	}
+	return serialized
+}
+
+// ErrUnauthorized is returned whenever a request has no valid session at
+// all, as opposed to NewAuthError, which wraps a specific auth failure.
+var ErrUnauthorized = Error{Kind: ErrKindAuth, Message: "unauthorized", code: codeAuth}
+
+// NewAuthError wraps a session/authentication failure.
+func NewAuthError(err error) Error {
+	return Error{Kind: ErrKindAuth, Message: err.Error(), code: codeAuth}
+}
+
+// NewQuotaError wraps a publish.Quota rejection (too large, too many
+// uploads, over disk budget, and so on).
+func NewQuotaError(err error) Error {
+	return Error{Kind: ErrKindQuota, Message: err.Error(), code: codeQuota}
+}
+
+// NewStorageError wraps a failure to read, write or remove an upload
+// through a Storage backend.
+func NewStorageError(err error) Error {
+	return Error{Kind: ErrKindStorage, Message: err.Error(), code: codeStorage}
+}
+
+// NewSDKError wraps a failure from the lbrynet SDK itself, once the
+// upload is otherwise valid and on disk.
+func NewSDKError(err error) Error {
+	return Error{Kind: ErrKindSDK, Message: err.Error(), code: codeSDK}
+}
+
+// NewValidationError wraps a malformed request: a bad multipart body, a
+// json_payload that doesn't parse, or a Pipeline rejection.
+func NewValidationError(err error) Error {
+	return Error{Kind: ErrKindValidation, Message: err.Error(), code: codeValidation}
+}
@@ -0,0 +1,169 @@
+package publish
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// JobStatus is the lifecycle state of an async publish Job.
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// Job tracks one asynchronous call to Publisher.Publish, from the moment
+// the upload's bytes land on disk to the SDK response (or error) coming
+// back, so GET /publish/jobs/{id} has something to report while a large
+// publish is still in flight.
+type Job struct {
+	ID        string
+	AccountID string
+	Status    JobStatus
+	Error     string
+	Result    json.RawMessage
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// JobStore persists Job state across the lifetime of a publish. Use
+// DBJobStore, not MemoryJobStore, wherever job status needs to survive a
+// process restart.
+type JobStore interface {
+	Create(Job) error
+	Save(Job) error
+	Get(id string) (Job, error)
+}
+
+// MemoryJobStore is a JobStore backed by an in-process map. Job status
+// doesn't survive a restart, so it's only appropriate where that's
+// acceptable (tests, a single dev node); production deployments should
+// use DBJobStore instead.
+type MemoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryJobStore returns an empty MemoryJobStore.
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: map[string]Job{}}
+}
+
+// Create implements JobStore.
+func (s *MemoryJobStore) Create(j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[j.ID] = j
+	return nil
+}
+
+// Save implements JobStore.
+func (s *MemoryJobStore) Save(j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[j.ID]; !ok {
+		return fmt.Errorf("job %v not found", j.ID)
+	}
+	s.jobs[j.ID] = j
+	return nil
+}
+
+// Get implements JobStore.
+func (s *MemoryJobStore) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job %v not found", id)
+	}
+	return j, nil
+}
+
+// DBJobStore is a JobStore backed by the application database, so job
+// status (and the eventual SDK result or error) survives a restart or
+// redeploy of the node that accepted the upload — the reason the async
+// Job model exists for multi-minute publishes in the first place. It
+// expects a table shaped like:
+//
+//	CREATE TABLE publish_jobs (
+//		id         TEXT PRIMARY KEY,
+//		account_id TEXT NOT NULL,
+//		status     TEXT NOT NULL,
+//		error      TEXT NOT NULL DEFAULT '',
+//		result     JSONB,
+//		created_at TIMESTAMPTZ NOT NULL,
+//		updated_at TIMESTAMPTZ NOT NULL
+//	);
+type DBJobStore struct {
+	db *sql.DB
+}
+
+// NewDBJobStore returns a DBJobStore backed by db.
+func NewDBJobStore(db *sql.DB) *DBJobStore {
+	return &DBJobStore{db: db}
+}
+
+// Create implements JobStore.
+func (s *DBJobStore) Create(j Job) error {
+	_, err := s.db.Exec(
+		`INSERT INTO publish_jobs (id, account_id, status, error, result, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		j.ID, j.AccountID, j.Status, j.Error, rawJSONOrNil(j.Result), j.CreatedAt, j.UpdatedAt,
+	)
+	return err
+}
+
+// Save implements JobStore.
+func (s *DBJobStore) Save(j Job) error {
+	res, err := s.db.Exec(
+		`UPDATE publish_jobs SET status = $2, error = $3, result = $4, updated_at = $5 WHERE id = $1`,
+		j.ID, j.Status, j.Error, rawJSONOrNil(j.Result), j.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("job %v not found", j.ID)
+	}
+	return nil
+}
+
+// Get implements JobStore.
+func (s *DBJobStore) Get(id string) (Job, error) {
+	var j Job
+	var result []byte
+	err := s.db.QueryRow(
+		`SELECT id, account_id, status, error, result, created_at, updated_at FROM publish_jobs WHERE id = $1`,
+		id,
+	).Scan(&j.ID, &j.AccountID, &j.Status, &j.Error, &result, &j.CreatedAt, &j.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return Job{}, fmt.Errorf("job %v not found", id)
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	if len(result) > 0 {
+		j.Result = json.RawMessage(result)
+	}
+	return j, nil
+}
+
+// rawJSONOrNil turns an empty json.RawMessage into a nil driver value, so
+// an empty/missing Result is stored as SQL NULL instead of an empty byte
+// string.
+func rawJSONOrNil(m json.RawMessage) interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	return []byte(m)
+}
@@ -0,0 +1,104 @@
+package publish
+
+import "fmt"
+
+// ProcessorResult holds whatever metadata a Processor discovered about
+// the uploaded file. Once a Pipeline finishes running, the upload
+// handlers copy MimeType, SHA256 and ThumbnailURL onto UploadInfo; of
+// these, only ThumbnailURL reaches the params LbrynetPublisher.Publish
+// sends to lbrynet.Client.StreamCreate.
+type ProcessorResult struct {
+	MimeType     string
+	SHA256       string
+	ThumbnailURL string
+	// ThumbnailPath is the local filesystem path ThumbnailProcessor wrote
+	// its output to, if it ran. runPipeline uses it to persist the
+	// thumbnail through Storage and clean up the local file afterwards,
+	// for backends whose objects aren't already reachable at path
+	// directly. Processors other than ThumbnailProcessor leave it empty.
+	ThumbnailPath string
+
+	// Rejected stops the pipeline early and should surface as a
+	// validation error instead of being published.
+	Rejected     bool
+	RejectReason string
+}
+
+// Processor inspects (and may rewrite in place) the uploaded file at
+// path, recording whatever it finds on result.
+type Processor interface {
+	Name() string
+	Process(path string, result *ProcessorResult) error
+}
+
+// Pipeline runs an ordered list of Processors over an uploaded file
+// between UploadHandler.CreateFile and Publisher.Publish, turning a raw
+// upload into one enriched with MIME validation, a thumbnail, optional
+// transcoding and a dedup fingerprint.
+type Pipeline struct {
+	Processors []Processor
+}
+
+// NewPipeline returns a Pipeline that runs processors in the given order.
+func NewPipeline(processors ...Processor) *Pipeline {
+	return &Pipeline{Processors: processors}
+}
+
+// Run executes each processor in order against path, stopping early if
+// one of them rejects the file.
+func (p *Pipeline) Run(path string) (ProcessorResult, error) {
+	var result ProcessorResult
+	for _, proc := range p.Processors {
+		if err := proc.Process(path, &result); err != nil {
+			return result, fmt.Errorf("publish pipeline: %v: %w", proc.Name(), err)
+		}
+		if result.Rejected {
+			break
+		}
+	}
+	return result, nil
+}
+
+// PipelineConfig lets operators choose which built-in processors run,
+// and in what order, e.g.:
+//
+//	publish:
+//	  pipeline:
+//	    stages: [mimetype, thumbnail, fingerprint]
+//	    thumbnail_base_url: https://thumbs.example.com
+type PipelineConfig struct {
+	Stages           []string `yaml:"stages"`
+	ThumbnailBaseURL string   `yaml:"thumbnail_base_url"`
+}
+
+// NewPipelineFromConfig builds a Pipeline out of the named built-in
+// stages in cfg.Stages, in the order given. thumbnail and transcode both
+// branch on the MimeType the mimetype stage discovers, so either is
+// rejected as a config error if it's listed before mimetype instead of
+// silently doing nothing for every upload.
+func NewPipelineFromConfig(cfg PipelineConfig) (*Pipeline, error) {
+	var processors []Processor
+	mimeSeen := false
+	for _, stage := range cfg.Stages {
+		switch stage {
+		case "mimetype":
+			processors = append(processors, MimeSniffProcessor{})
+			mimeSeen = true
+		case "thumbnail":
+			if !mimeSeen {
+				return nil, fmt.Errorf("publish pipeline: %q stage must come after %q", stage, "mimetype")
+			}
+			processors = append(processors, NewThumbnailProcessor(cfg.ThumbnailBaseURL))
+		case "transcode":
+			if !mimeSeen {
+				return nil, fmt.Errorf("publish pipeline: %q stage must come after %q", stage, "mimetype")
+			}
+			processors = append(processors, TranscodeProcessor{})
+		case "fingerprint":
+			processors = append(processors, FingerprintProcessor{})
+		default:
+			return nil, fmt.Errorf("unknown publish pipeline stage %q", stage)
+		}
+	}
+	return NewPipeline(processors...), nil
+}
@@ -0,0 +1,32 @@
+package publish
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// FingerprintProcessor records a SHA-256 of the uploaded file so
+// downstream code (or a future dedup check against previously published
+// fingerprints) can tell two uploads apart without re-reading them.
+type FingerprintProcessor struct{}
+
+// Name implements Processor.
+func (FingerprintProcessor) Name() string { return "fingerprint" }
+
+// Process implements Processor.
+func (FingerprintProcessor) Process(path string, result *ProcessorResult) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return err
+	}
+	result.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return nil
+}
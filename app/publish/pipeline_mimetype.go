@@ -0,0 +1,37 @@
+package publish
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// allowedMimePrefixes restricts publishes to the media types lbrynet
+// actually knows how to serve.
+var allowedMimePrefixes = []string{"video/", "audio/", "image/", "application/pdf"}
+
+// MimeSniffProcessor tags each upload with its detected MIME type and
+// rejects anything outside allowedMimePrefixes.
+type MimeSniffProcessor struct{}
+
+// Name implements Processor.
+func (MimeSniffProcessor) Name() string { return "mimetype" }
+
+// Process implements Processor.
+func (MimeSniffProcessor) Process(path string, result *ProcessorResult) error {
+	mime, err := mimetype.DetectFile(path)
+	if err != nil {
+		return err
+	}
+	result.MimeType = mime.String()
+
+	for _, prefix := range allowedMimePrefixes {
+		if strings.HasPrefix(result.MimeType, prefix) {
+			return nil
+		}
+	}
+	result.Rejected = true
+	result.RejectReason = fmt.Sprintf("disallowed mime type %v", result.MimeType)
+	return nil
+}
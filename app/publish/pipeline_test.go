@@ -0,0 +1,108 @@
+package publish
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeProcessor records that it ran and optionally rejects or errors, so
+// Pipeline.Run's ordering and early-exit behavior can be tested without
+// depending on ffmpeg or any other external binary.
+type fakeProcessor struct {
+	name   string
+	ran    *[]string
+	err    error
+	reject bool
+}
+
+func (p fakeProcessor) Name() string { return p.name }
+
+func (p fakeProcessor) Process(path string, result *ProcessorResult) error {
+	*p.ran = append(*p.ran, p.name)
+	if p.err != nil {
+		return p.err
+	}
+	if p.reject {
+		result.Rejected = true
+		result.RejectReason = p.name
+	}
+	return nil
+}
+
+func TestPipelineRunOrderAndEarlyExit(t *testing.T) {
+	var ran []string
+	p := NewPipeline(
+		fakeProcessor{name: "a", ran: &ran},
+		fakeProcessor{name: "b", ran: &ran, reject: true},
+		fakeProcessor{name: "c", ran: &ran},
+	)
+
+	result, err := p.Run("/tmp/whatever")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !result.Rejected || result.RejectReason != "b" {
+		t.Fatalf("expected rejection by %q, got %+v", "b", result)
+	}
+	if got, want := ran, []string{"a", "b"}; !equalStrings(got, want) {
+		t.Fatalf("ran processors = %v, want %v (should stop at the rejecting stage)", got, want)
+	}
+}
+
+func TestPipelineRunStopsOnError(t *testing.T) {
+	var ran []string
+	wantErr := errors.New("boom")
+	p := NewPipeline(
+		fakeProcessor{name: "a", ran: &ran},
+		fakeProcessor{name: "b", ran: &ran, err: wantErr},
+		fakeProcessor{name: "c", ran: &ran},
+	)
+
+	_, err := p.Run("/tmp/whatever")
+	if err == nil || !errors.Is(err, wantErr) {
+		t.Fatalf("Run() error = %v, want wrapping %v", err, wantErr)
+	}
+	if got, want := ran, []string{"a", "b"}; !equalStrings(got, want) {
+		t.Fatalf("ran processors = %v, want %v (should stop at the failing stage)", got, want)
+	}
+}
+
+func TestNewPipelineFromConfigStageOrdering(t *testing.T) {
+	cases := []struct {
+		name    string
+		stages  []string
+		wantErr bool
+	}{
+		{name: "mimetype then thumbnail", stages: []string{"mimetype", "thumbnail"}},
+		{name: "mimetype then transcode", stages: []string{"mimetype", "transcode"}},
+		{name: "fingerprint alone needs no mimetype", stages: []string{"fingerprint"}},
+		{name: "thumbnail before mimetype", stages: []string{"thumbnail", "mimetype"}, wantErr: true},
+		{name: "transcode before mimetype", stages: []string{"transcode", "mimetype"}, wantErr: true},
+		{name: "thumbnail without mimetype at all", stages: []string{"thumbnail"}, wantErr: true},
+		{name: "unknown stage", stages: []string{"bogus"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := NewPipelineFromConfig(PipelineConfig{Stages: c.stages})
+			if (err != nil) != c.wantErr {
+				t.Fatalf("NewPipelineFromConfig() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if err == nil && len(p.Processors) != len(c.stages) {
+				t.Fatalf("expected %d processors, got %d", len(c.stages), len(p.Processors))
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
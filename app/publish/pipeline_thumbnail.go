@@ -0,0 +1,50 @@
+package publish
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ThumbnailProcessor extracts a representative frame (for video) or a
+// resized copy (for images) via ffmpeg, and exposes it under
+// publicBaseURL so it can be passed on as thumbnail_url.
+type ThumbnailProcessor struct {
+	publicBaseURL string
+}
+
+// NewThumbnailProcessor returns a ThumbnailProcessor that publishes
+// generated thumbnails under publicBaseURL.
+func NewThumbnailProcessor(publicBaseURL string) *ThumbnailProcessor {
+	return &ThumbnailProcessor{publicBaseURL: publicBaseURL}
+}
+
+// Name implements Processor.
+func (*ThumbnailProcessor) Name() string { return "thumbnail" }
+
+// Process implements Processor.
+func (p *ThumbnailProcessor) Process(path string, result *ProcessorResult) error {
+	isVideo := strings.HasPrefix(result.MimeType, "video/")
+	isImage := strings.HasPrefix(result.MimeType, "image/")
+	if !isVideo && !isImage {
+		return nil
+	}
+
+	thumbPath := path + ".thumb.jpg"
+	args := []string{"-y", "-i", path}
+	if isVideo {
+		args = append(args, "-ss", "00:00:01.000", "-vframes", "1")
+	} else {
+		args = append(args, "-vf", "scale=320:-1")
+	}
+	args = append(args, thumbPath)
+
+	if out, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg thumbnail: %w (%s)", err, out)
+	}
+
+	result.ThumbnailPath = thumbPath
+	result.ThumbnailURL = strings.TrimSuffix(p.publicBaseURL, "/") + "/" + filepath.Base(thumbPath)
+	return nil
+}
@@ -0,0 +1,35 @@
+package publish
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// TranscodeProcessor re-encodes video uploads to H.264/AAC via ffmpeg so
+// they're guaranteed to play back in the browser, replacing path in
+// place once the re-encode succeeds.
+type TranscodeProcessor struct{}
+
+// Name implements Processor.
+func (TranscodeProcessor) Name() string { return "transcode" }
+
+// Process implements Processor.
+func (TranscodeProcessor) Process(path string, result *ProcessorResult) error {
+	if !strings.HasPrefix(result.MimeType, "video/") {
+		return nil
+	}
+
+	out := path + ".transcoded.mp4"
+	cmd := exec.Command("ffmpeg", "-y", "-i", path, "-c:v", "libx264", "-c:a", "aac", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg transcode: %w (%s)", err, output)
+	}
+
+	if err := os.Rename(out, path); err != nil {
+		return err
+	}
+	result.MimeType = "video/mp4"
+	return nil
+}
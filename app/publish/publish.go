@@ -1,14 +1,17 @@
 package publish
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"path"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/lbryio/lbrytv/app/proxy"
 	"github.com/lbryio/lbrytv/app/users"
@@ -18,38 +21,84 @@ import (
 	"github.com/ybbus/jsonrpc"
 )
 
-const uploadPath = "/tmp"
-
 const fileField = "file"
 const jsonrpcPayloadField = "json_payload"
 
+// maxJSONPayloadSize caps how much of the json_payload part Handle will
+// buffer in memory; the file part is streamed straight to disk instead.
+const maxJSONPayloadSize = 1 << 20
+
+// UploadInfo carries integrity metadata gathered while the upload's file
+// part was streamed to disk, plus whatever the publish Pipeline found
+// while processing it, so Publisher.Publish gets it without having to
+// re-read the file. LbrynetPublisher.Publish uses Size and ThumbnailURL to
+// fill in the query's file_size and thumbnail_url when the query leaves
+// them unset; MimeType and SHA256 are not sent to the SDK.
+type UploadInfo struct {
+	Size   int64
+	SHA256 string
+
+	MimeType     string
+	ThumbnailURL string
+}
+
 // Publisher is responsible for sending data to lbrynet
-// and should take file path, account ID and client query as a slice of bytes.
+// and should take the file's Locator, account ID, client query as a
+// slice of bytes, and the UploadInfo gathered while the file was
+// received.
 type Publisher interface {
-	Publish(string, string, []byte) ([]byte, error)
+	Publish(Locator, string, []byte, UploadInfo) ([]byte, error)
 }
 
-// LbrynetPublisher is an implementation of SDK publisher.
-type LbrynetPublisher struct{}
+// LbrynetPublisher is an implementation of SDK publisher. Storage is used
+// to resolve a Locator down to a file path the lbrynet SDK can read
+// directly, for backends that don't already expose one.
+type LbrynetPublisher struct {
+	Storage Storage
+}
 
 // UploadHandler glues HTTP uploads to the Publisher
 type UploadHandler struct {
-	Publisher  Publisher
-	uploadPath string
+	Publisher Publisher
+	Storage   Storage
+	// Pipeline, if set, runs between CreateFile and Publisher.Publish,
+	// enriching the upload with MIME validation, a thumbnail, optional
+	// transcoding and a dedup fingerprint. A nil Pipeline passes the
+	// upload straight through, unprocessed.
+	Pipeline *Pipeline
+	// Jobs tracks the Publisher.Publish call Handle kicks off in the
+	// background once the upload's bytes are on disk, so GET
+	// /publish/jobs/{id} has something to report against.
+	Jobs JobStore
+	// Quota, if set, is consulted before Handle accepts any bytes. A nil
+	// Quota leaves uploads unlimited.
+	Quota Quota
+	// MaxUploadSize hard-caps the multipart request body via
+	// http.MaxBytesReader before any of it is read. 0 disables the cap.
+	MaxUploadSize int64
 }
 
-// NewUploadHandler returns a HTTP upload handler object.
-func NewUploadHandler(uploadPath string, publisher Publisher) UploadHandler {
+// NewUploadHandler returns a HTTP upload handler object backed by storage,
+// running uploads through pipeline before publishing, tracking each
+// publish as a job in jobs and enforcing quota before accepting bytes.
+// pipeline and quota may be nil; maxUploadSize <= 0 disables the
+// http.MaxBytesReader cap.
+func NewUploadHandler(storage Storage, publisher Publisher, pipeline *Pipeline, jobs JobStore, quota Quota, maxUploadSize int64) UploadHandler {
 	return UploadHandler{
-		Publisher:  publisher,
-		uploadPath: uploadPath,
+		Publisher:     publisher,
+		Storage:       storage,
+		Pipeline:      pipeline,
+		Jobs:          jobs,
+		Quota:         quota,
+		MaxUploadSize: maxUploadSize,
 	}
 }
 
-// Publish takes a file path, account ID and client JSON-RPC query,
-// patches the query and sends it to the SDK for processing.
+// Publish takes a Locator, account ID, client JSON-RPC query and the
+// UploadInfo gathered while receiving the file, patches the query and
+// sends it to the SDK for processing.
 // Resulting response is then returned back as a slice of bytes.
-func (p *LbrynetPublisher) Publish(filePath, accountID string, rawQuery []byte) ([]byte, error) {
+func (p *LbrynetPublisher) Publish(loc Locator, accountID string, rawQuery []byte, info UploadInfo) ([]byte, error) {
 	// var rpcParams *lbrynet.PublishParams
 	// var rpcParams *ljsonrpc.StreamCreateOptions
 	rpcParams := struct {
@@ -64,37 +113,64 @@ func (p *LbrynetPublisher) Publish(filePath, accountID string, rawQuery []byte)
 
 	query, err := proxy.NewQuery(rawQuery)
 	if err != nil {
-		panic(err)
+		return nil, NewValidationError(err)
 	}
 
 	if err := query.ParamsToStruct(&rpcParams); err != nil {
-		panic(err)
+		return nil, NewValidationError(err)
 	}
 
 	if rpcParams.FilePath != "__POST_FILE__" {
-		panic("unknown file_path content")
+		return nil, NewValidationError(fmt.Errorf("unknown file_path content"))
 	}
 
+	filePath, cleanup, err := localPath(p.Storage, loc)
+	if err != nil {
+		return nil, NewStorageError(err)
+	}
+	defer cleanup()
+
 	bid, err := strconv.ParseFloat(rpcParams.Bid, 64)
+	if err != nil {
+		return nil, NewValidationError(err)
+	}
 	rpcParams.FilePath = filePath
 	rpcParams.AccountID = &accountID
+	if rpcParams.FileSize == nil {
+		size := strconv.FormatInt(info.Size, 10)
+		rpcParams.FileSize = &size
+	}
+	if info.ThumbnailURL != "" && rpcParams.ThumbnailURL == nil {
+		rpcParams.ThumbnailURL = &info.ThumbnailURL
+	}
 
 	result, err := lbrynet.Client.StreamCreate(rpcParams.Name, filePath, bid, *rpcParams.StreamCreateOptions)
 	if err != nil {
-		return nil, err
+		return nil, NewSDKError(err)
 	}
 
 	rpcResponse := jsonrpc.RPCResponse{Result: result}
 	serialized, err := json.MarshalIndent(rpcResponse, "", "  ")
 	if err != nil {
-		return nil, err
+		return nil, NewSDKError(err)
 	}
 	return serialized, nil
 }
 
-// Handle is where HTTP upload is handled and passed on to Publisher.
-// It should be wrapped with users.Authenticator.Wrap before it can be used
-// in a mux.Router.
+// Handle is where HTTP upload is handled and handed off to Publisher in
+// the background. It should be wrapped with users.Authenticator.Wrap
+// before it can be used in a mux.Router.
+// Instead of spooling the upload into a Go tmp file via FormFile and then
+// copying it again into the destination, it reads the multipart parts as
+// they arrive: json_payload is buffered in memory (up to
+// maxJSONPayloadSize), while the file part is streamed straight into the
+// file created by CreateFile, with a SHA-256 and byte count computed on
+// the fly via io.TeeReader.
+// Once the bytes are on disk (and, if configured, the Pipeline has run),
+// Handle creates a Job, returns its ID immediately, and drives
+// Publisher.Publish from a background goroutine; callers poll its result
+// via HandleJobStatus instead of holding the HTTP connection open for the
+// length of the publish.
 func (h UploadHandler) Handle(w http.ResponseWriter, r *users.AuthenticatedRequest) {
 	if !r.IsAuthenticated() {
 		var authErr Error
@@ -103,51 +179,288 @@ func (h UploadHandler) Handle(w http.ResponseWriter, r *users.AuthenticatedReque
 		} else {
 			authErr = ErrUnauthorized
 		}
-		w.WriteHeader(http.StatusOK)
-		w.Write(authErr.AsBytes())
+		writeError(w, authErr)
 		return
 	}
-	file, header, err := r.FormFile("file")
+
+	if h.MaxUploadSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.MaxUploadSize)
+	}
+
+	release := func() {}
+	if h.Quota != nil {
+		var err error
+		release, err = h.Quota.Reserve(r.AccountID, r.ContentLength)
+		if err != nil {
+			writeQuotaError(w, err)
+			return
+		}
+	}
+	defer release()
+
+	mr, err := r.MultipartReader()
 	if err != nil {
-		panic(err)
+		writeError(w, NewValidationError(err))
+		return
+	}
+
+	var payload []byte
+	var f io.WriteCloser
+	var loc Locator
+	var info UploadInfo
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, NewValidationError(err))
+			return
+		}
+
+		switch part.FormName() {
+		case jsonrpcPayloadField:
+			payload, err = ioutil.ReadAll(io.LimitReader(part, maxJSONPayloadSize))
+			if err != nil {
+				writeError(w, NewValidationError(err))
+				return
+			}
+		case fileField:
+			f, loc, err = h.CreateFile(r.AccountID, part.FileName())
+			if err != nil {
+				writeError(w, NewStorageError(err))
+				return
+			}
+			hasher := sha256.New()
+			written, err := io.Copy(f, io.TeeReader(part, hasher))
+			if err != nil {
+				f.Close()
+				if isMaxBytesError(err) {
+					writeQuotaError(w, err)
+				} else {
+					writeError(w, NewStorageError(err))
+				}
+				return
+			}
+			if err := f.Close(); err != nil {
+				writeError(w, NewStorageError(err))
+				return
+			}
+			info = UploadInfo{Size: written, SHA256: hex.EncodeToString(hasher.Sum(nil))}
+		}
+		part.Close()
 	}
-	defer file.Close()
 
-	f, err := h.CreateFile(r.AccountID, header.Filename)
+	if f == nil {
+		writeError(w, NewValidationError(fmt.Errorf("no %v field found in upload", fileField)))
+		return
+	}
+
+	if h.Pipeline != nil {
+		result, err := h.runPipeline(loc)
+		if err != nil {
+			h.Storage.Remove(loc)
+			writeError(w, NewStorageError(err))
+			return
+		}
+		if result.Rejected {
+			h.Storage.Remove(loc)
+			writeError(w, NewValidationError(fmt.Errorf("upload rejected: %v", result.RejectReason)))
+			return
+		}
+		if result.MimeType != "" {
+			info.MimeType = result.MimeType
+		}
+		info.ThumbnailURL = result.ThumbnailURL
+		if result.SHA256 != "" {
+			info.SHA256 = result.SHA256
+		}
+	}
+
+	if h.Quota != nil {
+		release()
+		h.Quota.Record(r.AccountID, info.Size)
+	}
+
+	id, err := generateUploadID()
 	if err != nil {
-		panic(err)
+		writeError(w, NewStorageError(err))
+		return
+	}
+
+	now := time.Now()
+	job := Job{ID: id, AccountID: r.AccountID, Status: JobPending, CreatedAt: now, UpdatedAt: now}
+	if err := h.Jobs.Create(job); err != nil {
+		writeError(w, NewStorageError(err))
+		return
 	}
 
-	if num, err := io.Copy(f, file); err != nil {
-		panic(err)
+	go h.runPublish(job, loc, r.AccountID, payload, info)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jobIDResponse(id))
+}
+
+// runPublish drives Publisher.Publish for job in the background, saving
+// its outcome to h.Jobs once it settles. On failure, the upload is
+// orphaned (lbrynet never took ownership of it), so runPublish removes it
+// from Storage and backs out the bytes Handle had already recorded
+// against the account's quota.
+func (h UploadHandler) runPublish(job Job, loc Locator, accountID string, payload []byte, info UploadInfo) {
+	job.Status = JobRunning
+	job.UpdatedAt = time.Now()
+	h.Jobs.Save(job)
+
+	result, err := h.Publisher.Publish(loc, accountID, payload, info)
+	job.UpdatedAt = time.Now()
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		h.Storage.Remove(loc)
+		if h.Quota != nil {
+			h.Quota.Record(accountID, -info.Size)
+		}
 	} else {
-		fmt.Println(num)
+		job.Status = JobDone
+		job.Result = json.RawMessage(result)
 	}
-	if err := f.Close(); err != nil {
-		panic(err)
+	h.Jobs.Save(job)
+}
+
+// HandleJobStatus processes `GET /publish/jobs/{id}`, reporting the
+// status of a publish previously kicked off by Handle.
+func (h UploadHandler) HandleJobStatus(w http.ResponseWriter, r *users.AuthenticatedRequest, id string) {
+	if !r.IsAuthenticated() {
+		writeError(w, ErrUnauthorized)
+		return
 	}
 
-	response, err := h.Publisher.Publish(f.Name(), r.AccountID, []byte(r.FormValue(jsonrpcPayloadField)))
+	job, err := h.Jobs.Get(id)
+	if err != nil || job.AccountID != r.AccountID {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(NewValidationError(fmt.Errorf("job %v not found", id)).AsBytes())
+		return
+	}
+
+	serialized, err := json.MarshalIndent(struct {
+		Status JobStatus       `json:"status"`
+		Error  string          `json:"error,omitempty"`
+		Result json.RawMessage `json:"result,omitempty"`
+	}{Status: job.Status, Error: job.Error, Result: job.Result}, "", "  ")
 	if err != nil {
-		panic(err)
+		writeError(w, NewSDKError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(serialized)
+}
+
+// writeError writes err to w as a JSON-RPC error response, tagging it as
+// an SDK error if it isn't already a publish.Error.
+func writeError(w http.ResponseWriter, err error) {
+	pubErr, ok := err.(Error)
+	if !ok {
+		pubErr = NewSDKError(err)
 	}
 	w.WriteHeader(http.StatusOK)
-	w.Write(response)
+	w.Write(pubErr.AsBytes())
+}
+
+// writeQuotaError writes err to w as a 413, the status a client (or a
+// load balancer in front of lbrytv) is expected to already understand,
+// rather than the 200-with-JSON-RPC-error-body convention the other
+// error kinds use.
+func writeQuotaError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	w.Write(NewQuotaError(err).AsBytes())
 }
 
-// CreateFile opens an empty file for writing inside the account's designated folder.
-// The final file path looks like `/upload_path/{account_id}/{random}_filename.ext`,
-// where `account_id` is local SDK account ID and `random` is a random string generated by ioutil.
-func (h UploadHandler) CreateFile(accountID string, origFilename string) (*os.File, error) {
-	path, err := h.preparePath(accountID)
+// isMaxBytesError reports whether err came from an http.MaxBytesReader
+// rejecting a request body that grew past its limit.
+func isMaxBytesError(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
+
+// jobIDResponse is what Handle returns immediately after accepting an
+// upload: the ID callers poll via HandleJobStatus.
+func jobIDResponse(id string) []byte {
+	serialized, _ := json.Marshal(struct {
+		JobID string `json:"job_id"`
+	}{JobID: id})
+	return serialized
+}
+
+// CreateFile opens an empty writer for the account's upload through
+// h.Storage and returns it along with the Locator identifying where it
+// will end up.
+func (h UploadHandler) CreateFile(accountID string, origFilename string) (io.WriteCloser, Locator, error) {
+	return h.Storage.Create(accountID, origFilename)
+}
+
+// runPipeline resolves loc down to a local path and runs h.Pipeline over
+// it, downloading the object to a temporary file first if Storage doesn't
+// already expose one. Processors like TranscodeProcessor rewrite that
+// path in place, so when the pipeline ran against a downloaded temp copy
+// rather than loc.Path itself, runPipeline writes the result back through
+// Storage before the temp copy is cleaned up — otherwise the rewrite
+// would be silently discarded and Publish would go on to read the
+// original, unprocessed object. ThumbnailProcessor instead produces a new
+// sibling file (ProcessorResult.ThumbnailPath) rather than rewriting path,
+// so that one is persisted through Storage under its own Locator and
+// cleaned up the same way, whenever it was generated against a temp copy.
+func (h UploadHandler) runPipeline(loc Locator) (ProcessorResult, error) {
+	path, cleanup, err := localPath(h.Storage, loc)
 	if err != nil {
-		panic(err)
+		return ProcessorResult{}, err
 	}
-	return ioutil.TempFile(path, fmt.Sprintf("*_%v", origFilename))
+	defer cleanup()
+
+	result, err := h.Pipeline.Run(path)
+	if err != nil || result.Rejected {
+		if result.ThumbnailPath != "" && loc.Path == "" {
+			os.Remove(result.ThumbnailPath)
+		}
+		return result, err
+	}
+
+	if loc.Path == "" {
+		if result.ThumbnailPath != "" {
+			defer os.Remove(result.ThumbnailPath)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return result, err
+		}
+		putErr := h.Storage.Put(loc, f)
+		f.Close()
+		if putErr != nil {
+			return result, putErr
+		}
+
+		if result.ThumbnailPath != "" {
+			if err := h.persistThumbnail(loc, result.ThumbnailPath); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
 }
 
-func (h UploadHandler) preparePath(accountID string) (string, error) {
-	path := path.Join(h.uploadPath, accountID)
-	err := os.MkdirAll(path, os.ModePerm)
-	return path, err
+// persistThumbnail uploads the thumbnail ThumbnailProcessor wrote to
+// thumbPath through Storage, under a Locator named after thumbPath's own
+// basename (matching the URL ThumbnailProcessor already built from it),
+// then removes the local file either way.
+func (h UploadHandler) persistThumbnail(loc Locator, thumbPath string) error {
+	defer os.Remove(thumbPath)
+
+	f, err := os.Open(thumbPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	thumbLoc := Locator{AccountID: loc.AccountID, Name: filepath.Base(thumbPath)}
+	return h.Storage.Put(thumbLoc, f)
 }
@@ -0,0 +1,156 @@
+package publish
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultQuotaWindow is the sliding window QuotaLimits.MaxUploadsPerHour
+// is measured over, when QuotaLimits is constructed with Window <= 0.
+const defaultQuotaWindow = time.Hour
+
+// QuotaLimits bounds what a single account may do through
+// UploadHandler.Handle. Any field left at zero is treated as unlimited.
+type QuotaLimits struct {
+	// MaxFileSize caps the size of a single upload.
+	MaxFileSize int64
+	// MaxAccountBytes caps the account's total uploaded bytes tracked
+	// under uploadPath/{account_id}.
+	MaxAccountBytes int64
+	// MaxUploadsPerHour caps how many uploads an account may start within
+	// Window (which defaults to an hour).
+	MaxUploadsPerHour int
+	// MaxConcurrentUploads caps how many uploads an account may have in
+	// flight at once.
+	MaxConcurrentUploads int
+	// Window is the sliding window MaxUploadsPerHour is measured over.
+	Window time.Duration
+}
+
+// Quota is consulted by UploadHandler.Handle before it accepts any bytes,
+// enforcing per-account limits on single-file size, total disk usage,
+// uploads-per-hour and concurrent in-flight uploads. Without it, a single
+// malicious authenticated client could fill the upload storage or tie up
+// every in-flight upload slot.
+type Quota interface {
+	// Reserve checks accountID against its limits for an upload of
+	// declaredSize bytes (the request's Content-Length) and, if it's
+	// allowed, counts it against the account's concurrent-upload and
+	// per-hour budgets. The returned release func must be called once the
+	// upload finishes, successfully or not, to free its concurrent-upload
+	// slot.
+	Reserve(accountID string, declaredSize int64) (release func(), err error)
+	// Record adds addedBytes to accountID's tracked disk usage once the
+	// final size of an upload is known. A negative addedBytes backs out
+	// bytes recorded for an upload that was later rejected by the
+	// pipeline or failed to publish, so a transient failure doesn't
+	// permanently eat into the account's quota.
+	Record(accountID string, addedBytes int64)
+}
+
+// accountQuota is the bookkeeping MemoryQuota keeps per account.
+type accountQuota struct {
+	bytesUsed     int64 // completed uploads, set by Record
+	bytesReserved int64 // declaredSize of uploads currently in flight
+	concurrent    int
+	starts        []time.Time
+}
+
+// MemoryQuota is a Quota backed by an in-process map. It enforces limits
+// correctly for a single lbrytv node; a multi-node deployment needs a
+// shared counter store (Redis, or the existing DB) behind the same
+// interface instead, since this one's counters don't survive a restart or
+// see uploads landing on another node.
+type MemoryQuota struct {
+	limits QuotaLimits
+
+	mu       sync.Mutex
+	accounts map[string]*accountQuota
+}
+
+// NewMemoryQuota returns a MemoryQuota enforcing limits.
+func NewMemoryQuota(limits QuotaLimits) *MemoryQuota {
+	if limits.Window <= 0 {
+		limits.Window = defaultQuotaWindow
+	}
+	return &MemoryQuota{limits: limits, accounts: map[string]*accountQuota{}}
+}
+
+// Reserve implements Quota.
+func (q *MemoryQuota) Reserve(accountID string, declaredSize int64) (func(), error) {
+	if declaredSize <= 0 {
+		// Content-Length wasn't reported (e.g. a chunked request body);
+		// assume the worst case so the size checks below can't be
+		// bypassed just by omitting it.
+		declaredSize = q.limits.MaxFileSize
+	}
+	if q.limits.MaxFileSize > 0 && declaredSize > q.limits.MaxFileSize {
+		return nil, fmt.Errorf("upload of %d bytes exceeds the %d byte limit", declaredSize, q.limits.MaxFileSize)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	a, ok := q.accounts[accountID]
+	if !ok {
+		a = &accountQuota{}
+		q.accounts[accountID] = a
+	}
+
+	now := time.Now()
+	a.starts = pruneBefore(a.starts, now.Add(-q.limits.Window))
+
+	if q.limits.MaxUploadsPerHour > 0 && len(a.starts) >= q.limits.MaxUploadsPerHour {
+		return nil, fmt.Errorf("account %v exceeded %d uploads per %v", accountID, q.limits.MaxUploadsPerHour, q.limits.Window)
+	}
+	if q.limits.MaxConcurrentUploads > 0 && a.concurrent >= q.limits.MaxConcurrentUploads {
+		return nil, fmt.Errorf("account %v has too many uploads in flight (max %d)", accountID, q.limits.MaxConcurrentUploads)
+	}
+	if q.limits.MaxAccountBytes > 0 && a.bytesUsed+a.bytesReserved+declaredSize > q.limits.MaxAccountBytes {
+		return nil, fmt.Errorf("account %v would exceed its %d byte upload quota", accountID, q.limits.MaxAccountBytes)
+	}
+
+	a.starts = append(a.starts, now)
+	a.concurrent++
+	a.bytesReserved += declaredSize
+
+	released := false
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if released {
+			return
+		}
+		released = true
+		a.concurrent--
+		a.bytesReserved -= declaredSize
+	}, nil
+}
+
+// Record implements Quota. It should be called once, after the upload's
+// release func, so the provisional reservation Reserve made against
+// declaredSize is replaced by the upload's actual size. Passing a
+// negative addedBytes subtracts from bytesUsed instead, to back out an
+// upload that didn't end up published.
+func (q *MemoryQuota) Record(accountID string, addedBytes int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	a, ok := q.accounts[accountID]
+	if !ok {
+		a = &accountQuota{}
+		q.accounts[accountID] = a
+	}
+	a.bytesUsed += addedBytes
+}
+
+// pruneBefore drops every timestamp in ts older than cutoff.
+func pruneBefore(ts []time.Time, cutoff time.Time) []time.Time {
+	kept := ts[:0]
+	for _, t := range ts {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
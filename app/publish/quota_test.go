@@ -0,0 +1,135 @@
+package publish
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryQuotaReserveLimits(t *testing.T) {
+	cases := []struct {
+		name    string
+		limits  QuotaLimits
+		setup   func(q *MemoryQuota)
+		size    int64
+		wantErr bool
+	}{
+		{
+			name:   "under every limit",
+			limits: QuotaLimits{MaxFileSize: 100, MaxAccountBytes: 1000, MaxUploadsPerHour: 5, MaxConcurrentUploads: 5},
+			size:   10,
+		},
+		{
+			name:    "exceeds MaxFileSize",
+			limits:  QuotaLimits{MaxFileSize: 100},
+			size:    101,
+			wantErr: true,
+		},
+		{
+			name:   "zero declaredSize assumes MaxFileSize",
+			limits: QuotaLimits{MaxFileSize: 100, MaxAccountBytes: 50},
+			size:   0,
+			// declaredSize becomes 100, which exceeds MaxAccountBytes.
+			wantErr: true,
+		},
+		{
+			name:   "exceeds MaxConcurrentUploads",
+			limits: QuotaLimits{MaxConcurrentUploads: 1},
+			setup: func(q *MemoryQuota) {
+				if _, err := q.Reserve("acct", 1); err != nil {
+					t.Fatalf("setup Reserve: %v", err)
+				}
+			},
+			size:    1,
+			wantErr: true,
+		},
+		{
+			name:   "exceeds MaxAccountBytes",
+			limits: QuotaLimits{MaxAccountBytes: 100},
+			setup: func(q *MemoryQuota) {
+				q.Record("acct", 90)
+			},
+			size:    20,
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := NewMemoryQuota(c.limits)
+			if c.setup != nil {
+				c.setup(q)
+			}
+			_, err := q.Reserve("acct", c.size)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("Reserve() error = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemoryQuotaReserveMaxUploadsPerHourSlidingWindow(t *testing.T) {
+	q := NewMemoryQuota(QuotaLimits{MaxUploadsPerHour: 1, Window: time.Hour})
+
+	if _, err := q.Reserve("acct", 1); err != nil {
+		t.Fatalf("first Reserve: %v", err)
+	}
+	if _, err := q.Reserve("acct", 1); err == nil {
+		t.Fatal("second Reserve within the window should have been rejected")
+	}
+
+	// Manually age out the first start so the window no longer counts it.
+	q.mu.Lock()
+	q.accounts["acct"].starts[0] = time.Now().Add(-2 * time.Hour)
+	q.mu.Unlock()
+
+	if _, err := q.Reserve("acct", 1); err != nil {
+		t.Fatalf("Reserve after the window elapsed: %v", err)
+	}
+}
+
+func TestMemoryQuotaReserveReleaseFreesConcurrentSlot(t *testing.T) {
+	q := NewMemoryQuota(QuotaLimits{MaxConcurrentUploads: 1})
+
+	release, err := q.Reserve("acct", 1)
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if _, err := q.Reserve("acct", 1); err == nil {
+		t.Fatal("Reserve should fail while the slot is still held")
+	}
+
+	release()
+	if _, err := q.Reserve("acct", 1); err != nil {
+		t.Fatalf("Reserve after release: %v", err)
+	}
+
+	// release must be idempotent: calling it again must not free the slot
+	// a second time and let a third Reserve sneak in beyond the limit.
+	release()
+	if _, err := q.Reserve("acct", 1); err == nil {
+		t.Fatal("a second release() call must not free an extra concurrent slot")
+	}
+}
+
+func TestMemoryQuotaRecordNegativeBacksOutUsage(t *testing.T) {
+	q := NewMemoryQuota(QuotaLimits{MaxAccountBytes: 100})
+
+	q.Record("acct", 80)
+	if _, err := q.Reserve("acct", 30); err == nil {
+		t.Fatal("Reserve should fail: 80 used + 30 declared exceeds the 100 byte quota")
+	}
+
+	q.Record("acct", -80)
+	if _, err := q.Reserve("acct", 30); err != nil {
+		t.Fatalf("Reserve after reversal: %v", err)
+	}
+}
+
+func TestPruneBefore(t *testing.T) {
+	now := time.Now()
+	ts := []time.Time{now.Add(-2 * time.Hour), now.Add(-30 * time.Minute), now}
+	kept := pruneBefore(ts, now.Add(-time.Hour))
+	if len(kept) != 2 {
+		t.Fatalf("expected 2 timestamps to survive the cutoff, got %d", len(kept))
+	}
+}
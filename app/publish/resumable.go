@@ -0,0 +1,484 @@
+package publish
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lbryio/lbrytv/app/users"
+)
+
+// tusResumableVersion is the protocol version advertised in the
+// Tus-Resumable header, per https://tus.io/protocols/resumable-upload.html.
+const tusResumableVersion = "1.0.0"
+
+// defaultUploadTTL is how long an upload may sit idle before the janitor
+// reclaims it, when NewResumableUploadHandler is called with ttl <= 0.
+const defaultUploadTTL = 24 * time.Hour
+
+// upload tracks the bookkeeping tus needs for a single in-progress
+// resumable upload: where the bytes are landing, how many have arrived,
+// a running SHA-256 of the bytes received so far, and the JSON-RPC
+// payload to replay once the file is complete. mu guards offset, hasher
+// and touchedAt, which a PATCH mutates while it streams the request body
+// in; everything else is fixed at creation time.
+type upload struct {
+	accountID string
+	length    int64
+	payload   []byte
+	path      string
+	// release frees the Quota reservation length was checked against.
+	// It's a no-op if Quota is nil, and safe to call more than once.
+	release func()
+
+	mu        sync.Mutex
+	offset    int64
+	hasher    hash.Hash
+	touchedAt time.Time
+}
+
+// ResumableUploadHandler implements the tus.io 1.0 resumable upload
+// protocol on top of the same Publisher used by UploadHandler, so that
+// large publishes survive dropped connections instead of requiring the
+// whole file to arrive in a single multipart POST.
+type ResumableUploadHandler struct {
+	Publisher  Publisher
+	uploadPath string
+	ttl        time.Duration
+	// Quota, if set, is consulted before HandleCreate allocates storage
+	// for a new upload, using the same per-account limits UploadHandler
+	// enforces for regular multipart uploads.
+	Quota Quota
+	// Pipeline, if set, runs once an upload reassembles to its full
+	// length and before Publisher.Publish, the same MIME validation,
+	// thumbnail, transcode and fingerprint pipeline UploadHandler.Handle
+	// runs for multipart uploads — without it, /publish/resumable would
+	// be a way to bypass the pipeline's mimetype allowlist entirely.
+	Pipeline *Pipeline
+	// Jobs tracks the Publisher.Publish call HandlePatch kicks off in the
+	// background once an upload reassembles to its full length, the same
+	// way UploadHandler.Handle does for multipart uploads, so a publish
+	// from a multi-gigabyte resumable upload doesn't tie up the PATCH's
+	// HTTP connection for however long the SDK takes.
+	Jobs JobStore
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+// NewResumableUploadHandler returns a tus.io handler rooted at uploadPath,
+// running completed uploads through pipeline before publishing, tracking
+// publishes in jobs and enforcing quota (nil leaves uploads unlimited).
+// pipeline may be nil. Uploads that receive no PATCH for longer than ttl
+// are expired by the background janitor; ttl <= 0 falls back to
+// defaultUploadTTL.
+func NewResumableUploadHandler(uploadPath string, publisher Publisher, pipeline *Pipeline, jobs JobStore, ttl time.Duration, quota Quota) *ResumableUploadHandler {
+	if ttl <= 0 {
+		ttl = defaultUploadTTL
+	}
+	h := &ResumableUploadHandler{
+		Publisher:  publisher,
+		uploadPath: uploadPath,
+		ttl:        ttl,
+		Quota:      quota,
+		Pipeline:   pipeline,
+		Jobs:       jobs,
+		uploads:    map[string]*upload{},
+	}
+	go h.janitor()
+	return h
+}
+
+// HandleCreate processes `POST /publish/resumable`, allocating storage for
+// the upload and returning its location in the `Location` header.
+func (h *ResumableUploadHandler) HandleCreate(w http.ResponseWriter, r *users.AuthenticatedRequest) {
+	if !r.IsAuthenticated() {
+		writeTusError(w, ErrUnauthorized)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeTusErrorStatus(w, http.StatusBadRequest, NewValidationError(fmt.Errorf("invalid or missing Upload-Length")))
+		return
+	}
+
+	release := func() {}
+	if h.Quota != nil {
+		release, err = h.Quota.Reserve(r.AccountID, length)
+		if err != nil {
+			writeTusErrorStatus(w, http.StatusRequestEntityTooLarge, NewQuotaError(err))
+			return
+		}
+	}
+
+	id, err := generateUploadID()
+	if err != nil {
+		release()
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+
+	dir := path.Join(h.uploadPath, r.AccountID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		release()
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+	dest := path.Join(dir, id)
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		release()
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+	if err := f.Close(); err != nil {
+		release()
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+
+	payload, err := uploadMetadataValue(r.Header.Get("Upload-Metadata"), jsonrpcPayloadField)
+	if err != nil {
+		release()
+		writeTusErrorStatus(w, http.StatusBadRequest, NewValidationError(err))
+		return
+	}
+
+	h.mu.Lock()
+	h.uploads[id] = &upload{
+		accountID: r.AccountID,
+		length:    length,
+		hasher:    sha256.New(),
+		payload:   payload,
+		path:      dest,
+		touchedAt: time.Now(),
+		release:   release,
+	}
+	h.mu.Unlock()
+
+	w.Header().Set("Tus-Resumable", tusResumableVersion)
+	w.Header().Set("Location", path.Join("/publish/resumable", id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleHead processes `HEAD /publish/resumable/{id}`, reporting how many
+// bytes have been received so far via Upload-Offset.
+func (h *ResumableUploadHandler) HandleHead(w http.ResponseWriter, r *users.AuthenticatedRequest, id string) {
+	if !r.IsAuthenticated() {
+		writeTusError(w, ErrUnauthorized)
+		return
+	}
+
+	u, err := h.get(id, r.AccountID)
+	if err != nil {
+		writeTusErrorStatus(w, http.StatusNotFound, NewValidationError(err))
+		return
+	}
+
+	u.mu.Lock()
+	offset := u.offset
+	u.mu.Unlock()
+
+	w.Header().Set("Tus-Resumable", tusResumableVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePatch processes `PATCH /publish/resumable/{id}`, appending the
+// request body at the offset it claims to start from. Once the upload
+// reaches its declared length, HandlePatch removes it from h.uploads and
+// drives Publisher.Publish from a background goroutine the same way
+// UploadHandler.Handle does, returning a job ID immediately instead of
+// holding the connection open for the length of the publish; callers poll
+// its result via HandleJobStatus.
+func (h *ResumableUploadHandler) HandlePatch(w http.ResponseWriter, r *users.AuthenticatedRequest, id string) {
+	if !r.IsAuthenticated() {
+		writeTusError(w, ErrUnauthorized)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		writeTusErrorStatus(w, http.StatusUnsupportedMediaType, NewValidationError(fmt.Errorf("unsupported Content-Type")))
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		writeTusErrorStatus(w, http.StatusBadRequest, NewValidationError(fmt.Errorf("invalid or missing Upload-Offset")))
+		return
+	}
+
+	u, err := h.get(id, r.AccountID)
+	if err != nil {
+		writeTusErrorStatus(w, http.StatusNotFound, NewValidationError(err))
+		return
+	}
+
+	// u.mu serializes the whole request body against any other PATCH for
+	// the same upload ID: offset, hasher and touchedAt are all mutated
+	// below, and io.Copy alone holds no lock over u.hasher.
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if offset != u.offset {
+		writeTusErrorStatus(w, http.StatusConflict, NewValidationError(fmt.Errorf("Upload-Offset does not match current offset")))
+		return
+	}
+
+	f, err := os.OpenFile(u.path, os.O_WRONLY, 0644)
+	if err != nil {
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+	if _, err := f.Seek(offset, 0); err != nil {
+		f.Close()
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+	// Cap the write at what's left of the declared Upload-Length: nothing
+	// else bounds r.Body, and Quota only ever reserved that declared
+	// length, so without this a client could declare a tiny Upload-Length
+	// and then stream an arbitrarily large body in on a single PATCH.
+	remaining := u.length - offset
+	written, err := io.CopyN(f, io.TeeReader(r.Body, u.hasher), remaining)
+	f.Close()
+	if err != nil && err != io.EOF {
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+	if written == remaining {
+		var extra [1]byte
+		if n, _ := r.Body.Read(extra[:]); n > 0 {
+			writeTusErrorStatus(w, http.StatusConflict, NewValidationError(fmt.Errorf("PATCH body exceeds declared Upload-Length")))
+			return
+		}
+	}
+
+	u.offset += written
+	u.touchedAt = time.Now()
+	complete := u.offset >= u.length
+
+	w.Header().Set("Tus-Resumable", tusResumableVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.offset, 10))
+
+	if !complete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// The upload has fully reassembled: release its tus bookkeeping
+	// regardless of how the pipeline or publish that follow turn out, so
+	// a rejection or a failed/slow SDK call can never leave id stuck
+	// occupying h.uploads.
+	u.release()
+	h.mu.Lock()
+	delete(h.uploads, id)
+	h.mu.Unlock()
+
+	info := UploadInfo{Size: u.offset, SHA256: hex.EncodeToString(u.hasher.Sum(nil))}
+
+	if h.Pipeline != nil {
+		result, err := h.Pipeline.Run(u.path)
+		if err != nil {
+			os.Remove(u.path)
+			writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+			return
+		}
+		if result.Rejected {
+			os.Remove(u.path)
+			writeTusErrorStatus(w, http.StatusUnprocessableEntity, NewValidationError(fmt.Errorf("upload rejected: %v", result.RejectReason)))
+			return
+		}
+		if result.MimeType != "" {
+			info.MimeType = result.MimeType
+		}
+		info.ThumbnailURL = result.ThumbnailURL
+		if result.SHA256 != "" {
+			info.SHA256 = result.SHA256
+		}
+	}
+
+	if h.Quota != nil {
+		h.Quota.Record(u.accountID, info.Size)
+	}
+
+	jobID, err := generateUploadID()
+	if err != nil {
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+
+	now := time.Now()
+	job := Job{ID: jobID, AccountID: u.accountID, Status: JobPending, CreatedAt: now, UpdatedAt: now}
+	if err := h.Jobs.Create(job); err != nil {
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewStorageError(err))
+		return
+	}
+
+	loc := Locator{AccountID: u.accountID, Path: u.path}
+	go h.runPublish(job, loc, u.accountID, u.payload, info)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jobIDResponse(jobID))
+}
+
+// runPublish drives Publisher.Publish for job in the background, saving
+// its outcome to h.Jobs once it settles, mirroring
+// UploadHandler.runPublish. On failure the reassembled file is orphaned
+// (lbrynet never took ownership of it) and the quota bytes HandlePatch
+// already recorded for it are backed out.
+func (h *ResumableUploadHandler) runPublish(job Job, loc Locator, accountID string, payload []byte, info UploadInfo) {
+	job.Status = JobRunning
+	job.UpdatedAt = time.Now()
+	h.Jobs.Save(job)
+
+	result, err := h.Publisher.Publish(loc, accountID, payload, info)
+	job.UpdatedAt = time.Now()
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		os.Remove(loc.Path)
+		if h.Quota != nil {
+			h.Quota.Record(accountID, -info.Size)
+		}
+	} else {
+		job.Status = JobDone
+		job.Result = json.RawMessage(result)
+	}
+	h.Jobs.Save(job)
+}
+
+// HandleJobStatus processes `GET /publish/jobs/{id}` for a publish
+// HandlePatch kicked off, the same way UploadHandler.HandleJobStatus does
+// for multipart uploads.
+func (h *ResumableUploadHandler) HandleJobStatus(w http.ResponseWriter, r *users.AuthenticatedRequest, id string) {
+	if !r.IsAuthenticated() {
+		writeTusError(w, ErrUnauthorized)
+		return
+	}
+
+	job, err := h.Jobs.Get(id)
+	if err != nil || job.AccountID != r.AccountID {
+		writeTusErrorStatus(w, http.StatusNotFound, NewValidationError(fmt.Errorf("job %v not found", id)))
+		return
+	}
+
+	serialized, err := json.MarshalIndent(struct {
+		Status JobStatus       `json:"status"`
+		Error  string          `json:"error,omitempty"`
+		Result json.RawMessage `json:"result,omitempty"`
+	}{Status: job.Status, Error: job.Error, Result: job.Result}, "", "  ")
+	if err != nil {
+		writeTusErrorStatus(w, http.StatusInternalServerError, NewSDKError(err))
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusResumableVersion)
+	w.WriteHeader(http.StatusOK)
+	w.Write(serialized)
+}
+
+func (h *ResumableUploadHandler) get(id, accountID string) (*upload, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	u, ok := h.uploads[id]
+	if !ok || u.accountID != accountID {
+		return nil, fmt.Errorf("upload %v not found", id)
+	}
+	return u, nil
+}
+
+// janitor periodically removes uploads that have had no activity for
+// longer than h.ttl, along with their partial files on disk.
+func (h *ResumableUploadHandler) janitor() {
+	ticker := time.NewTicker(h.ttl / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.expireStale()
+	}
+}
+
+func (h *ResumableUploadHandler) expireStale() {
+	h.mu.Lock()
+	uploads := make(map[string]*upload, len(h.uploads))
+	for id, u := range h.uploads {
+		uploads[id] = u
+	}
+	h.mu.Unlock()
+
+	// Each upload's staleness is checked with only u.mu held, and removed
+	// from h.uploads with only h.mu held, never both at once, so this
+	// can't deadlock against HandlePatch's u.mu-then-h.mu ordering.
+	for id, u := range uploads {
+		u.mu.Lock()
+		stale := time.Since(u.touchedAt) > h.ttl
+		u.mu.Unlock()
+		if !stale {
+			continue
+		}
+
+		h.mu.Lock()
+		delete(h.uploads, id)
+		h.mu.Unlock()
+
+		u.release()
+		os.Remove(u.path)
+	}
+}
+
+func writeTusError(w http.ResponseWriter, authErr Error) {
+	writeTusErrorStatus(w, http.StatusUnauthorized, authErr)
+}
+
+// writeTusErrorStatus writes err to w as a JSON-RPC error response, the
+// same wire format writeError uses for the plain multipart upload
+// handler, with the Tus-Resumable header tus requires on every response
+// and status as the HTTP status code.
+func writeTusErrorStatus(w http.ResponseWriter, status int, err Error) {
+	w.Header().Set("Tus-Resumable", tusResumableVersion)
+	w.WriteHeader(status)
+	w.Write(err.AsBytes())
+}
+
+func generateUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// uploadMetadataValue extracts and base64-decodes a single key from the
+// Upload-Metadata header, whose format is a comma-separated list of
+// `key base64(value)` pairs.
+func uploadMetadataValue(header, key string) ([]byte, error) {
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, " ", 2)
+		if parts[0] != key {
+			continue
+		}
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("metadata key %v has no value", key)
+		}
+		return base64.StdEncoding.DecodeString(parts[1])
+	}
+	return nil, fmt.Errorf("missing %v in Upload-Metadata", key)
+}
@@ -0,0 +1,108 @@
+package publish
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadMetadataValue(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	cases := []struct {
+		name    string
+		header  string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "single key",
+			header: fmt.Sprintf("%s %s", jsonrpcPayloadField, encode(`{"method":"stream_create"}`)),
+			key:    jsonrpcPayloadField,
+			want:   `{"method":"stream_create"}`,
+		},
+		{
+			name:   "key among several, with spacing",
+			header: fmt.Sprintf(" filename %s, %s %s ", encode("movie.mp4"), jsonrpcPayloadField, encode(`{}`)),
+			key:    jsonrpcPayloadField,
+			want:   `{}`,
+		},
+		{
+			name:    "missing key",
+			header:  fmt.Sprintf("filename %s", encode("movie.mp4")),
+			key:     jsonrpcPayloadField,
+			wantErr: true,
+		},
+		{
+			name:    "key with no value",
+			header:  jsonrpcPayloadField,
+			key:     jsonrpcPayloadField,
+			wantErr: true,
+		},
+		{
+			name:    "malformed base64",
+			header:  jsonrpcPayloadField + " not-valid-base64!!",
+			key:     jsonrpcPayloadField,
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := uploadMetadataValue(c.header, c.key)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("uploadMetadataValue() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if err == nil && string(got) != c.want {
+				t.Fatalf("uploadMetadataValue() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGenerateUploadID(t *testing.T) {
+	a, err := generateUploadID()
+	if err != nil {
+		t.Fatalf("generateUploadID() error = %v", err)
+	}
+	if len(a) != 32 {
+		t.Fatalf("generateUploadID() = %q, want a 32-character hex string", a)
+	}
+
+	b, err := generateUploadID()
+	if err != nil {
+		t.Fatalf("generateUploadID() error = %v", err)
+	}
+	if a == b {
+		t.Fatalf("generateUploadID() returned the same ID twice: %q", a)
+	}
+}
+
+func TestWriteTusErrorStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	err := NewValidationError(fmt.Errorf("bad offset"))
+
+	writeTusErrorStatus(rec, http.StatusConflict, err)
+
+	if got := rec.Code; got != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", got, http.StatusConflict)
+	}
+	if got := rec.Header().Get("Tus-Resumable"); got != tusResumableVersion {
+		t.Fatalf("Tus-Resumable header = %q, want %q", got, tusResumableVersion)
+	}
+	if got, want := rec.Body.Bytes(), err.AsBytes(); string(got) != string(want) {
+		t.Fatalf("body = %s, want %s", got, want)
+	}
+}
+
+func TestWriteTusErrorDefaultsToUnauthorized(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeTusError(rec, ErrUnauthorized)
+
+	if got := rec.Code; got != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
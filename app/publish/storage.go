@@ -0,0 +1,76 @@
+package publish
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Locator identifies where an uploaded file lives once a Storage backend
+// has accepted it. Path is populated whenever the backend exposes a
+// filesystem path the lbrynet SDK can read directly — always true for
+// LocalStorage, and optionally true for remote backends configured with a
+// shared mount; it is empty for object-store-only locations, in which case
+// callers must go through Storage.Open to read the bytes back.
+type Locator struct {
+	AccountID string
+	Name      string
+	Path      string
+}
+
+// Storage abstracts where uploaded files are written to, read back from
+// and removed, so UploadHandler and ResumableUploadHandler don't need to
+// know whether files end up on local disk, S3 or GCS. This lets lbrytv
+// frontends run stateless behind a load balancer, since upload state no
+// longer has to live on the node that first accepted the bytes.
+type Storage interface {
+	// Create opens a new object for writing under accountID, named after
+	// (but not necessarily identical to) name, and returns its Locator.
+	Create(accountID, name string) (io.WriteCloser, Locator, error)
+	// Open returns a reader over a previously created object.
+	Open(Locator) (io.ReadCloser, error)
+	// Put overwrites the object at loc with the contents of r. It's how a
+	// Pipeline's output (a transcoded file, a generated thumbnail path)
+	// gets written back for backends where localPath had to download the
+	// object to a throwaway temp copy to run the pipeline against, since
+	// otherwise whatever the pipeline rewrote in place is discarded the
+	// moment that temp copy is cleaned up.
+	Put(loc Locator, r io.Reader) error
+	// Remove deletes a previously created object.
+	Remove(Locator) error
+}
+
+// localPath turns loc into a path on the local filesystem, for code (the
+// publish pipeline, the lbrynet SDK) that needs to read the upload off
+// disk directly. Local storage and remote backends configured with a
+// shared mount already populate loc.Path; anything else is streamed down
+// to a temporary file instead, which the returned cleanup func removes
+// once the caller is done with it.
+func localPath(storage Storage, loc Locator) (string, func(), error) {
+	noop := func() {}
+	if loc.Path != "" {
+		return loc.Path, noop, nil
+	}
+
+	r, err := storage.Open(loc)
+	if err != nil {
+		return "", noop, err
+	}
+	defer r.Close()
+
+	f, err := ioutil.TempFile("", fmt.Sprintf("*_%v", loc.Name))
+	if err != nil {
+		return "", noop, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", noop, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", noop, err
+	}
+	return f.Name(), func() { os.Remove(f.Name()) }, nil
+}
@@ -0,0 +1,65 @@
+package publish
+
+import (
+	"context"
+	"io"
+	"path"
+
+	"cloud.google.com/go/storage"
+)
+
+// GCSStorage implements Storage on top of a Google Cloud Storage bucket.
+// sharedMountPath, when set, points at the same bucket mounted locally
+// (e.g. via gcsfuse) so LbrynetPublisher can hand the SDK a plain file
+// path instead of streaming the object down to a temp file first.
+type GCSStorage struct {
+	bucket          *storage.BucketHandle
+	keyPrefix       string
+	sharedMountPath string
+}
+
+// NewGCSStorage returns a GCSStorage backed by the named bucket, with
+// object names prefixed by keyPrefix. sharedMountPath may be empty if the
+// bucket isn't mounted locally anywhere lbrynet can see.
+func NewGCSStorage(client *storage.Client, bucketName, keyPrefix, sharedMountPath string) *GCSStorage {
+	return &GCSStorage{
+		bucket:          client.Bucket(bucketName),
+		keyPrefix:       keyPrefix,
+		sharedMountPath: sharedMountPath,
+	}
+}
+
+func (s *GCSStorage) object(accountID, name string) *storage.ObjectHandle {
+	return s.bucket.Object(path.Join(s.keyPrefix, accountID, name))
+}
+
+// Create returns a writer that uploads its bytes to GCS as they're
+// written; Close flushes and finalizes the object.
+func (s *GCSStorage) Create(accountID, name string) (io.WriteCloser, Locator, error) {
+	w := s.object(accountID, name).NewWriter(context.Background())
+	loc := Locator{AccountID: accountID, Name: name}
+	if s.sharedMountPath != "" {
+		loc.Path = path.Join(s.sharedMountPath, s.keyPrefix, accountID, name)
+	}
+	return w, loc, nil
+}
+
+// Open returns a reader streaming the object's bytes from GCS.
+func (s *GCSStorage) Open(loc Locator) (io.ReadCloser, error) {
+	return s.object(loc.AccountID, loc.Name).NewReader(context.Background())
+}
+
+// Put overwrites the object at loc with the contents of r.
+func (s *GCSStorage) Put(loc Locator, r io.Reader) error {
+	w := s.object(loc.AccountID, loc.Name).NewWriter(context.Background())
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Remove deletes the object from GCS.
+func (s *GCSStorage) Remove(loc Locator) error {
+	return s.object(loc.AccountID, loc.Name).Delete(context.Background())
+}
@@ -0,0 +1,61 @@
+package publish
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// LocalStorage implements Storage on top of the local filesystem, rooted
+// at basePath. This is the backend lbrytv has always used, kept as the
+// default so single-node deployments don't need any extra configuration.
+type LocalStorage struct {
+	basePath string
+}
+
+// NewLocalStorage returns a LocalStorage rooted at basePath.
+func NewLocalStorage(basePath string) *LocalStorage {
+	return &LocalStorage{basePath: basePath}
+}
+
+// Create opens an empty file for writing inside the account's designated
+// folder. The final file path looks like
+// `{basePath}/{account_id}/{random}_{name}`, where `random` is a random
+// string generated by ioutil.TempFile.
+func (s *LocalStorage) Create(accountID, name string) (io.WriteCloser, Locator, error) {
+	dir := path.Join(s.basePath, accountID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, Locator{}, err
+	}
+	f, err := ioutil.TempFile(dir, fmt.Sprintf("*_%v", name))
+	if err != nil {
+		return nil, Locator{}, err
+	}
+	return f, Locator{AccountID: accountID, Name: name, Path: f.Name()}, nil
+}
+
+// Open returns a reader over the file at loc.Path.
+func (s *LocalStorage) Open(loc Locator) (io.ReadCloser, error) {
+	return os.Open(loc.Path)
+}
+
+// Put overwrites the file at loc.Path with the contents of r. LocalStorage
+// always exposes loc.Path directly, so a Pipeline already edits the file
+// in place; Put exists to satisfy Storage for callers that don't know
+// which backend they're talking to.
+func (s *LocalStorage) Put(loc Locator, r io.Reader) error {
+	f, err := os.OpenFile(loc.Path, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// Remove deletes the file at loc.Path.
+func (s *LocalStorage) Remove(loc Locator) error {
+	return os.Remove(loc.Path)
+}
@@ -0,0 +1,119 @@
+package publish
+
+import (
+	"io"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Storage implements Storage on top of an S3 (or S3-compatible) bucket.
+// sharedMountPath, when set, points at the same bucket mounted locally
+// (e.g. via s3fs or goofys) so LbrynetPublisher can hand the SDK a plain
+// file path instead of streaming the object down to a temp file first.
+type S3Storage struct {
+	bucket          string
+	keyPrefix       string
+	sharedMountPath string
+
+	uploader   *s3manager.Uploader
+	downloader *s3manager.Downloader
+	client     *s3.S3
+}
+
+// NewS3Storage returns an S3Storage backed by bucket, with keys prefixed
+// by keyPrefix. sharedMountPath may be empty if the bucket isn't mounted
+// locally anywhere lbrynet can see.
+func NewS3Storage(sess *session.Session, bucket, keyPrefix, sharedMountPath string) *S3Storage {
+	return &S3Storage{
+		bucket:          bucket,
+		keyPrefix:       keyPrefix,
+		sharedMountPath: sharedMountPath,
+		uploader:        s3manager.NewUploader(sess),
+		downloader:      s3manager.NewDownloader(sess),
+		client:          s3.New(sess),
+	}
+}
+
+func (s *S3Storage) key(accountID, name string) string {
+	return path.Join(s.keyPrefix, accountID, name)
+}
+
+// Create returns a pipe whose writer end is uploaded to S3 in the
+// background; the returned io.WriteCloser's Close blocks until the
+// upload completes (or fails).
+func (s *S3Storage) Create(accountID, name string) (io.WriteCloser, Locator, error) {
+	key := s.key(accountID, name)
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := s.uploader.Upload(&s3manager.UploadInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+			Body:   pr,
+		})
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	loc := Locator{AccountID: accountID, Name: name}
+	if s.sharedMountPath != "" {
+		loc.Path = path.Join(s.sharedMountPath, key)
+	}
+	return &s3WriteCloser{pw: pw, done: done}, loc, nil
+}
+
+// Open returns a reader streaming the object's bytes from S3.
+func (s *S3Storage) Open(loc Locator) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(loc.AccountID, loc.Name)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// Put overwrites the object at loc with the contents of r, re-uploading
+// it to the same key.
+func (s *S3Storage) Put(loc Locator, r io.Reader) error {
+	_, err := s.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(loc.AccountID, loc.Name)),
+		Body:   r,
+	})
+	return err
+}
+
+// Remove deletes the object from S3.
+func (s *S3Storage) Remove(loc Locator) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(loc.AccountID, loc.Name)),
+	})
+	return err
+}
+
+// s3WriteCloser adapts the write end of an io.Pipe so that Close waits
+// for the background s3manager upload to finish instead of just closing
+// the pipe.
+type s3WriteCloser struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *s3WriteCloser) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *s3WriteCloser) Close() error {
+	if err := w.pw.Close(); err != nil {
+		return err
+	}
+	return <-w.done
+}